@@ -3,13 +3,14 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/sha512"
-	"encoding/base32"
 	"encoding/base64"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"regexp"
@@ -20,102 +21,173 @@ import (
 	"sync/atomic"
 	"time"
 
-	"golang.org/x/crypto/sha3"
+	"filippo.io/edwards25519"
+
+	"github.com/rebroad/oniongen-go/pkg/oaddr"
 )
 
 // PrefixMatch represents a matched prefix and its corresponding onion address and key
 type PrefixMatch struct {
-	Prefix      string
-	OnionAddr   string
+	Prefix    string
+	OnionAddr string
+	// PrivateKey is the base64 encoding of the 64-byte expanded Tor secret
+	// key (current reduced scalar || nonce), i.e. the same bytes that go into
+	// hs_ed25519_secret_key. It is no longer a raw ed25519 seed, since the
+	// incremental scalar search below never generates one.
 	PrivateKey  string
 	Attempts    uint64
 	ElapsedTime time.Duration
 }
 
+// basePoint and scalarOne are the shared constants used to step the
+// incremental scalar search: each candidate's point is the previous one
+// plus the Edwards base point, keeping the scalar and public key in sync
+// without any further hashing or randomness. Both are read-only and safe
+// to share across worker goroutines.
+var (
+	basePoint = edwards25519.NewGeneratorPoint()
+	scalarOne = mustScalarFromUint64(1)
+)
+
+func mustScalarFromUint64(n uint64) *edwards25519.Scalar {
+	var buf [32]byte
+	for i := 0; i < 8; i++ {
+		buf[i] = byte(n >> (8 * uint(i)))
+	}
+	s, err := edwards25519.NewScalar().SetCanonicalBytes(buf[:])
+	checkErr(err)
+	return s
+}
+
+// randomExpandedScalar picks a random 32-byte seed, expands it with
+// SHA-512 and clamps it the way Ed25519 clamps a private key, yielding a
+// valid Curve25519 scalar `a` plus the upper-half "nonce" bytes that Tor's
+// hs_ed25519_secret_key format stores alongside it.
+func randomExpandedScalar() (*edwards25519.Scalar, [32]byte) {
+	var seed [32]byte
+	_, err := io.ReadFull(rand.Reader, seed[:])
+	checkErr(err)
+
+	expanded := sha512.Sum512(seed[:])
+	expanded[0] &= 248
+	expanded[31] &= 127
+	expanded[31] |= 64
+
+	scalar, err := edwards25519.NewScalar().SetBytesWithClamping(expanded[:32])
+	checkErr(err)
+
+	var nonce [32]byte
+	copy(nonce[:], expanded[32:])
+	return scalar, nonce
+}
+
 // Output mode constants
 const (
 	TorMode     = "tor"
 	BitcoinMode = "bitcoin"
 )
 
-func generate(wg *sync.WaitGroup, re *regexp.Regexp, prefixes []string, outputMode string, outputPath string, resultChan chan PrefixMatch) {
-	var attempts uint64
+// generate runs the vanity search on one worker. Instead of calling
+// ed25519.GenerateKey per attempt, it derives a single random scalar/point
+// pair up front and then steps both forward by the fixed group element B
+// (the Edwards base point) and 1 respectively on every iteration. That
+// replaces a SHA-512 expansion plus a scalar multiplication per try with a
+// single point addition, which is the standard incremental-scalar trick
+// used by vanity address generators such as mkp224o.
+func generate(wg *sync.WaitGroup, re *regexp.Regexp, trie *prefixTrie, outputMode string, outputPath string, emitIPv6 bool, logState *outputLog, resultChan chan PrefixMatch) {
+	var attempts, lastLoggedAttempts uint64
 	startTime := time.Now()
 
-	for {
-		// Use crypto/rand explicitly for secure random generation
-		publicKey, secretKey, err := ed25519.GenerateKey(rand.Reader)
-		checkErr(err)
+	scalar, nonce := randomExpandedScalar()
+	point := new(edwards25519.Point).ScalarBaseMult(scalar)
 
+	for {
 		atomic.AddUint64(&attempts, 1)
+		publicKey := ed25519.PublicKey(point.Bytes())
 		onionAddress := encodePublicKey(publicKey)
 
-		// If prefixes are provided, check against them
-		if len(prefixes) > 0 {
-			for _, prefix := range prefixes {
-				if strings.HasPrefix(onionAddress, prefix) {
-					match := PrefixMatch{
-						Prefix:      prefix,
-						OnionAddr:   onionAddress,
-						PrivateKey:  base64.StdEncoding.EncodeToString(secretKey[:32]),
-						Attempts:    attempts,
-						ElapsedTime: time.Since(startTime),
+		if logState != nil && attempts-lastLoggedAttempts >= logAttemptBatch {
+			logState.addAttempts(attempts - lastLoggedAttempts)
+			lastLoggedAttempts = attempts
+		}
+
+		// If a prefix trie is loaded, check against it
+		if trie != nil {
+			if prefix, ok := trie.match(onionAddress); ok {
+				secretKey := expandSecretKey(scalar, nonce)
+				match := PrefixMatch{
+					Prefix:      prefix,
+					OnionAddr:   onionAddress,
+					PrivateKey:  base64.StdEncoding.EncodeToString(secretKey[:]),
+					Attempts:    attempts,
+					ElapsedTime: time.Since(startTime),
+				}
+
+				if outputMode == TorMode {
+					saveTorFormat(onionAddress, publicKey, secretKey, emitIPv6)
+				}
+				if emitIPv6 {
+					fmt.Printf("%s.onion -> %s\n", onionAddress, onionCatIPv6(publicKey))
+				}
+				if logState != nil {
+					if _, err := logState.append(onionAddress, publicKey, secretKey); err != nil && err != errLogTargetReached {
+						fmt.Printf("Error appending to log: %v\n", err)
 					}
-					resultChan <- match
-					break
 				}
+
+				resultChan <- match
 			}
 		} else if re != nil && re.MatchString(onionAddress) {
 			// If using regex pattern
 			fmt.Println(onionAddress)
+			secretKey := expandSecretKey(scalar, nonce)
 			match := PrefixMatch{
 				Prefix:      "",
 				OnionAddr:   onionAddress,
-				PrivateKey:  base64.StdEncoding.EncodeToString(secretKey[:32]),
+				PrivateKey:  base64.StdEncoding.EncodeToString(secretKey[:]),
 				Attempts:    attempts,
 				ElapsedTime: time.Since(startTime),
 			}
 
 			if outputMode == TorMode {
-				saveTorFormat(onionAddress, publicKey, expandSecretKey(secretKey))
+				saveTorFormat(onionAddress, publicKey, secretKey, emitIPv6)
+			}
+			if emitIPv6 {
+				fmt.Printf("%s.onion -> %s\n", onionAddress, onionCatIPv6(publicKey))
+			}
+			if logState != nil {
+				if _, err := logState.append(onionAddress, publicKey, secretKey); err != nil {
+					fmt.Printf("Error appending to log: %v\n", err)
+				}
 			}
 
 			resultChan <- match
 		}
+
+		scalar.Add(scalar, scalarOne)
+		point.Add(point, basePoint)
 	}
 }
 
-func expandSecretKey(secretKey ed25519.PrivateKey) [64]byte {
-
-	hash := sha512.Sum512(secretKey[:32])
-	hash[0] &= 248
-	hash[31] &= 127
-	hash[31] |= 64
-	return hash
-
+// expandSecretKey reassembles the 64-byte form Tor expects in
+// hs_ed25519_secret_key: the current (incremented) scalar followed by the
+// nonce half produced once at worker start. Tor stores this expanded form
+// rather than a seed, so no original seed needs to be recovered.
+func expandSecretKey(scalar *edwards25519.Scalar, nonce [32]byte) [64]byte {
+	var expanded [64]byte
+	copy(expanded[:32], scalar.Bytes())
+	copy(expanded[32:], nonce[:])
+	return expanded
 }
 
+// encodePublicKey renders publicKey as a lowercase v3 onion address. The
+// actual checksum + base32 encoding now lives in pkg/oaddr so that CLI
+// callers and downstream importers share one implementation.
 func encodePublicKey(publicKey ed25519.PublicKey) string {
-
-	// checksum = H(".onion checksum" || pubkey || version)
-	var checksumBytes bytes.Buffer
-	checksumBytes.Write([]byte(".onion checksum"))
-	checksumBytes.Write([]byte(publicKey))
-	checksumBytes.Write([]byte{0x03})
-	checksum := sha3.Sum256(checksumBytes.Bytes())
-
-	// onion_address = base32(pubkey || checksum || version)
-	var onionAddressBytes bytes.Buffer
-	onionAddressBytes.Write([]byte(publicKey))
-	onionAddressBytes.Write([]byte(checksum[:2]))
-	onionAddressBytes.Write([]byte{0x03})
-	onionAddress := base32.StdEncoding.EncodeToString(onionAddressBytes.Bytes())
-
-	return strings.ToLower(onionAddress)
-
+	return oaddr.Encode(publicKey)
 }
 
-func saveTorFormat(onionAddress string, publicKey ed25519.PublicKey, secretKey [64]byte) {
+func saveTorFormat(onionAddress string, publicKey ed25519.PublicKey, secretKey [64]byte, emitIPv6 bool) {
 	os.MkdirAll(onionAddress, 0700)
 
 	secretKeyFile := append([]byte("== ed25519v1-secret: type0 ==\x00\x00\x00"), secretKey[:]...)
@@ -124,7 +196,11 @@ func saveTorFormat(onionAddress string, publicKey ed25519.PublicKey, secretKey [
 	publicKeyFile := append([]byte("== ed25519v1-public: type0 ==\x00\x00\x00"), publicKey...)
 	checkErr(ioutil.WriteFile(onionAddress+"/hs_ed25519_public_key", publicKeyFile, 0600))
 
-	checkErr(ioutil.WriteFile(onionAddress+"/hostname", []byte(onionAddress+".onion\n"), 0600))
+	hostnameFile := onionAddress + ".onion\n"
+	if emitIPv6 {
+		hostnameFile += fmt.Sprintf("# OnionCat IPv6: %s\n", onionCatIPv6(publicKey))
+	}
+	checkErr(ioutil.WriteFile(onionAddress+"/hostname", []byte(hostnameFile), 0600))
 }
 
 func saveBitcoinFormatMulti(matches []PrefixMatch, outputPath string) {
@@ -148,7 +224,11 @@ func saveBitcoinFormatMulti(matches []PrefixMatch, outputPath string) {
 	// Write each key to the file
 	writer := bufio.NewWriter(file)
 	for _, match := range matches {
-		// Encode the key in the format Bitcoin Core expects
+		// Encode the key in the format Bitcoin Core expects. match.PrivateKey
+		// is now the base64 of the 64-byte expanded secret key (scalar ||
+		// nonce) rather than a 32-byte seed, since the incremental scalar
+		// search has no seed to hand back; consumers expecting a seed must
+		// be updated accordingly.
 		bitcoinKeyFormat := "ED25519-V3:" + match.PrivateKey + "\n"
 
 		_, err := writer.WriteString(bitcoinKeyFormat)
@@ -185,6 +265,7 @@ func printUsage() {
 	fmt.Println("Vanity Onion Address Generator")
 	fmt.Println("\nUsage:")
 	fmt.Println("  oniongen-go [options] <regex> <number>")
+	fmt.Println("  oniongen-go verify <onion-address>")
 	fmt.Println("\nArguments:")
 	fmt.Println("  regex    - Regular expression pattern addresses should match (base32 chars: a-z, 2-7)")
 	fmt.Println("           - Not required if using -prefixfile")
@@ -194,16 +275,103 @@ func printUsage() {
 	fmt.Println("  -output     - Output file path (for bitcoin mode)")
 	fmt.Println("  -prefixfile - Path to file containing address prefixes (one per line)")
 	fmt.Println("                If provided, regex argument is ignored")
+	fmt.Println("  -publish          - Register each match as an ephemeral hidden service once found")
+	fmt.Println("  -publish-port     - remote:local port to forward, e.g. 80:8080 (default 80:8080)")
+	fmt.Println("  -control-addr     - Tor control port to attach to (default 127.0.0.1:9051)")
+	fmt.Println("  -control-password - Tor control port password")
+	fmt.Println("  -embedded         - Launch tor in-process instead of attaching to -control-addr")
+	fmt.Println("  -ipv6             - Also print/save the OnionCat-style IPv6 mapping of each match")
+	fmt.Println("  -log              - Append matches to this file as a resumable, self-contained log")
 	fmt.Println("\nExamples:")
 	fmt.Println("  oniongen-go \"^test\" 5                        # Generate 5 addresses starting with 'test' in Tor format")
 	fmt.Println("  oniongen-go -mode=bitcoin \"^btc\" 1            # Generate 1 address starting with 'btc' in Bitcoin format")
 	fmt.Println("  oniongen-go -mode=bitcoin -output=/path/to/onion_v3_private_key \"^btc\" 1")
 	fmt.Println("  oniongen-go -mode=bitcoin -prefixfile=prefixes.txt 5  # Generate 5 addresses with prefixes from file")
+	fmt.Println("  oniongen-go -publish -publish-port=80:8080 \"^test\" 1  # Generate and publish as a hidden service")
+	fmt.Println("  oniongen-go -ipv6 \"^test\" 1                   # Also show the OnionCat IPv6 mapping")
+	fmt.Println("  oniongen-go -log=addresses.txt \"^test\" 50     # Resumable batch search logged to one file")
+	fmt.Println("  oniongen-go verify abcd...xyz.onion            # Check the address's saved key material matches it")
 	fmt.Println("\nReferences:")
 	fmt.Println("  - Tor v3 onion address specification: https://github.com/torproject/torspec/blob/master/rend-spec-v3.txt")
 }
 
-// readPrefixFile reads prefixes from a file (one per line)
+// runVerify implements the `verify` subcommand: it parses the given address,
+// then cross-checks it against the hs_ed25519_public_key/hs_ed25519_secret_key
+// saveTorFormat wrote alongside it, confirming the saved key material really
+// does produce this address rather than just that the address is well-formed.
+func runVerify(args []string) {
+	if len(args) != 1 {
+		fmt.Println("Usage: oniongen-go verify <onion-address>")
+		os.Exit(1)
+	}
+
+	pubKey, err := oaddr.Parse(args[0])
+	if err != nil {
+		fmt.Printf("Invalid onion address: %v\n", err)
+		os.Exit(1)
+	}
+
+	addr := oaddr.Encode(pubKey)
+	fmt.Printf("%s.onion is a valid v3 onion address\n", addr)
+
+	if err := verifyKeyMaterial(addr, pubKey); err != nil {
+		fmt.Printf("Key material check failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("%s/hs_ed25519_public_key and hs_ed25519_secret_key match the address\n", addr)
+}
+
+// verifyKeyMaterial reads hs_ed25519_public_key and hs_ed25519_secret_key
+// from the onionAddress directory saveTorFormat writes them into, and
+// confirms both agree with pubKey: the public key file must contain pubKey
+// verbatim, and the secret key file's scalar must derive pubKey via scalar*B.
+func verifyKeyMaterial(onionAddress string, pubKey ed25519.PublicKey) error {
+	publicKeyFile, err := ioutil.ReadFile(onionAddress + "/hs_ed25519_public_key")
+	if err != nil {
+		return fmt.Errorf("reading hs_ed25519_public_key: %w", err)
+	}
+	if !bytes.Equal(publicKeyFile, append([]byte(torPublicKeyHeader), pubKey...)) {
+		return fmt.Errorf("hs_ed25519_public_key does not match %s.onion", onionAddress)
+	}
+
+	secretKeyFile, err := ioutil.ReadFile(onionAddress + "/hs_ed25519_secret_key")
+	if err != nil {
+		return fmt.Errorf("reading hs_ed25519_secret_key: %w", err)
+	}
+	wantLen := len(torSecretKeyHeader) + 64
+	if len(secretKeyFile) != wantLen {
+		return fmt.Errorf("hs_ed25519_secret_key has unexpected length %d, want %d", len(secretKeyFile), wantLen)
+	}
+
+	// scalarBytes is already the final reduced scalar expandSecretKey wrote
+	// (scalar.Bytes()), not a raw seed, so it must be decoded as-is with
+	// SetCanonicalBytes - reapplying clamping here would derive a different
+	// scalar from the one that actually generated the address.
+	scalarBytes := secretKeyFile[len(torSecretKeyHeader) : len(torSecretKeyHeader)+32]
+	scalar, err := edwards25519.NewScalar().SetCanonicalBytes(scalarBytes)
+	if err != nil {
+		return fmt.Errorf("parsing scalar from hs_ed25519_secret_key: %w", err)
+	}
+
+	derived := new(edwards25519.Point).ScalarBaseMult(scalar).Bytes()
+	if !bytes.Equal(derived, pubKey) {
+		return fmt.Errorf("hs_ed25519_secret_key does not derive %s.onion", onionAddress)
+	}
+
+	return nil
+}
+
+// maxSensiblePrefixLength is the point past which a single prefix becomes
+// unreachable at current single-machine throughput (32^n candidates); past
+// this, readPrefixFile warns rather than silently accepting the entry.
+const maxSensiblePrefixLength = 8
+
+var base32PrefixPattern = regexp.MustCompile(`^[a-z2-7]+$`)
+
+// readPrefixFile reads prefixes from a file (one per line), rejecting
+// entries that cannot appear in a base32-encoded onion address and warning
+// about entries long enough to be practically unreachable.
 func readPrefixFile(filepath string) ([]string, error) {
 	file, err := os.Open(filepath)
 	if err != nil {
@@ -214,10 +382,17 @@ func readPrefixFile(filepath string) ([]string, error) {
 	var prefixes []string
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
-		prefix := strings.TrimSpace(scanner.Text())
-		if prefix != "" {
-			prefixes = append(prefixes, prefix)
+		prefix := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if prefix == "" {
+			continue
+		}
+		if !base32PrefixPattern.MatchString(prefix) {
+			return nil, fmt.Errorf("invalid prefix %q: must contain only base32 characters (a-z, 2-7)", prefix)
 		}
+		if len(prefix) > maxSensiblePrefixLength {
+			fmt.Printf("Warning: prefix %q is %d characters long; expect on the order of 32^%d attempts to match\n", prefix, len(prefix), len(prefix))
+		}
+		prefixes = append(prefixes, prefix)
 	}
 
 	if err := scanner.Err(); err != nil {
@@ -232,10 +407,24 @@ func readPrefixFile(filepath string) ([]string, error) {
 }
 
 func main() {
+	// The "verify" subcommand lives outside the flag package's vocabulary,
+	// so it's dispatched on os.Args before flag.Parse ever runs.
+	if len(os.Args) > 1 && os.Args[1] == "verify" {
+		runVerify(os.Args[2:])
+		return
+	}
+
 	// Define command-line flags
 	outputMode := flag.String("mode", TorMode, "Output mode: 'tor' or 'bitcoin'")
 	outputPath := flag.String("output", "", "Output file path (for bitcoin mode)")
 	prefixFilePath := flag.String("prefixfile", "", "Path to file containing address prefixes (one per line)")
+	publish := flag.Bool("publish", false, "Publish each match as an ephemeral hidden service once found")
+	publishPort := flag.String("publish-port", "80:8080", "remote:local port to forward (with -publish)")
+	controlAddr := flag.String("control-addr", "127.0.0.1:9051", "Tor control port address (with -publish)")
+	controlPassword := flag.String("control-password", "", "Tor control port password (with -publish)")
+	embedded := flag.Bool("embedded", false, "Launch tor in-process instead of attaching to -control-addr (with -publish)")
+	ipv6 := flag.Bool("ipv6", false, "Also print/save the OnionCat-style IPv6 mapping of each match")
+	logPath := flag.String("log", "", "Append matches to this file as a resumable, self-contained log")
 
 	// Custom usage message
 	flag.Usage = printUsage
@@ -243,6 +432,30 @@ func main() {
 
 	args := flag.Args()
 
+	var publishCfg publishConfig
+	var pub *publisher
+	if *publish {
+		remotePort, localPort, err := parsePublishPort(*publishPort)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		publishCfg = publishConfig{
+			enabled:         true,
+			remotePort:      remotePort,
+			localPort:       localPort,
+			controlAddr:     *controlAddr,
+			controlPassword: *controlPassword,
+			embedded:        *embedded,
+		}
+
+		pub, err = newPublisher(context.Background(), publishCfg)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	// Validate the output mode
 	if *outputMode != TorMode && *outputMode != BitcoinMode {
 		fmt.Printf("Invalid output mode: %s. Must be 'tor' or 'bitcoin'\n", *outputMode)
@@ -298,12 +511,43 @@ func main() {
 
 	// Create a regex pattern if we're not using prefixes from a file
 	var re *regexp.Regexp
+	var trie *prefixTrie
 	if len(prefixes) == 0 {
 		re, err = regexp.Compile(pattern)
 		if err != nil {
 			fmt.Printf("Invalid regular expression: %v\n", err)
 			os.Exit(1)
 		}
+	} else {
+		trie = buildPrefixTrie(prefixes)
+	}
+
+	var logState *outputLog
+	if *logPath != "" {
+		logState, err = openOutputLog(*logPath, number)
+		if err != nil {
+			fmt.Printf("Error opening log: %v\n", err)
+			os.Exit(1)
+		}
+
+		number = logState.remaining()
+		if number <= 0 {
+			fmt.Printf("%s already has %d/%d matches; nothing to do\n", *logPath, logState.progress.Found, logState.progress.Target)
+			os.Exit(0)
+		}
+		fmt.Printf("Resuming %s: %d match(es) already found, %d to go, %.0f attempts/sec so far\n",
+			*logPath, logState.progress.Found, number, logState.attemptsPerSecond())
+
+		go func() {
+			for range time.Tick(10 * time.Second) {
+				if err := logState.flushProgress(); err != nil {
+					fmt.Printf("Error saving log progress: %v\n", err)
+				}
+				found, target := logState.foundTarget()
+				fmt.Printf("%s: %d/%d found, %.0f attempts/sec\n",
+					*logPath, found, target, logState.attemptsPerSecond())
+			}
+		}()
 	}
 
 	fmt.Printf("Generating %d addresses with %d CPU cores\n", number, runtime.NumCPU())
@@ -322,12 +566,31 @@ func main() {
 			matches = append(matches, match)
 			atomic.AddInt32(&matchCount, 1)
 
+			if publishCfg.enabled {
+				onionAddress, err := pub.publish(publishCfg.remotePort, publishCfg.localPort, match.PrivateKey)
+				if err != nil {
+					fmt.Printf("Error publishing %s.onion: %v\n", match.OnionAddr, err)
+				} else {
+					fmt.Printf("Published %s forwarding port %d to 127.0.0.1:%d\n",
+						onionAddress, publishCfg.remotePort, publishCfg.localPort)
+				}
+			}
+
 			// If we've found enough matches, exit
 			if atomic.LoadInt32(&matchCount) >= int32(number) {
 				// In Bitcoin mode, save all matches to a single file
 				if *outputMode == BitcoinMode {
 					saveBitcoinFormatMulti(matches, *outputPath)
 				}
+				if logState != nil {
+					if err := logState.flushProgress(); err != nil {
+						fmt.Printf("Error saving log progress: %v\n", err)
+					}
+					logState.close()
+				}
+				if pub != nil {
+					pub.close()
+				}
 				os.Exit(0)
 			}
 		}
@@ -336,7 +599,7 @@ func main() {
 	// Start worker goroutines
 	for i := 0; i < runtime.NumCPU(); i++ {
 		wg.Add(1)
-		go generate(&wg, re, prefixes, *outputMode, *outputPath, resultChan)
+		go generate(&wg, re, trie, *outputMode, *outputPath, *ipv6, logState, resultChan)
 	}
 
 	// Wait for all workers to complete (this will never happen in normal circumstances)
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"filippo.io/edwards25519"
+)
+
+// TestExpandedScalarRoundTrip guards against the chunk0-2 regression where
+// re-clamping an already-reduced scalar read back from hs_ed25519_secret_key
+// derived the wrong public key: it expands a fresh scalar, persists it the
+// way expandSecretKey does, decodes it back with SetCanonicalBytes (as
+// verifyKeyMaterial does), and confirms it still derives the same address.
+func TestExpandedScalarRoundTrip(t *testing.T) {
+	scalar, nonce := randomExpandedScalar()
+	pubKey := new(edwards25519.Point).ScalarBaseMult(scalar).Bytes()
+
+	secretKey := expandSecretKey(scalar, nonce)
+
+	decoded, err := edwards25519.NewScalar().SetCanonicalBytes(secretKey[:32])
+	if err != nil {
+		t.Fatalf("SetCanonicalBytes: %v", err)
+	}
+
+	derived := new(edwards25519.Point).ScalarBaseMult(decoded).Bytes()
+	if !bytes.Equal(derived, pubKey) {
+		t.Fatalf("derived public key %x does not match original %x", derived, pubKey)
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"net"
+)
+
+// onionCatPrefix is the ORCHID-like /48 prefix OnionCat (and compatible
+// crypto-currency P2P stacks, e.g. Neutrino/lnd) use to map onion
+// addresses into net.IP-shaped IPv6 addresses.
+var onionCatPrefix = [6]byte{0xfd, 0x87, 0xd8, 0x7e, 0xeb, 0x43}
+
+// onionCatIPv6 maps publicKey onto an OnionCat-style IPv6 address:
+// onionCatPrefix followed by the first 80 bits of SHA-256(publicKey). This
+// follows the onion3/tor3 convention for v3 addresses, whose 32-byte
+// public key is too large to embed directly the way a v2 address's
+// 80-bit identifier was.
+func onionCatIPv6(publicKey ed25519.PublicKey) net.IP {
+	sum := sha256.Sum256(publicKey)
+
+	addr := make(net.IP, 16)
+	copy(addr[:6], onionCatPrefix[:])
+	copy(addr[6:], sum[:10])
+
+	return addr
+}
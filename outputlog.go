@@ -0,0 +1,174 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// errLogTargetReached is returned by append once the log already holds
+// Target matches, so callers racing to find "one more" than requested
+// don't push Found past Target or write extra lines.
+var errLogTargetReached = errors.New("outputLog: target already reached")
+
+// torPublicKeyHeader and torSecretKeyHeader are the fixed headers Tor
+// expects at the start of hs_ed25519_public_key/hs_ed25519_secret_key;
+// embedding them in the log means a line is reconstructible back to a
+// HiddenServiceDir with nothing more than `base64 -d`.
+const (
+	torPublicKeyHeader = "== ed25519v1-public: type0 ==\x00\x00\x00"
+	torSecretKeyHeader = "== ed25519v1-secret: type0 ==\x00\x00\x00"
+)
+
+// logAttemptBatch bounds how often a worker reports its attempt count into
+// the shared outputLog, so the per-try progress bookkeeping doesn't erode
+// the throughput gained by the incremental scalar search.
+const logAttemptBatch = 1 << 16
+
+// outputLog appends discovered addresses to a single append-only file,
+// one line per match: "index address.onion base64(pubkey_file_bytes)
+// base64(secret_key_file_bytes)". It also maintains a small JSON progress
+// sidecar (<log>.progress.json) so an interrupted long-running search can
+// report accurate cumulative attempts/sec and resume a -n batch target
+// across restarts.
+type outputLog struct {
+	file         *os.File
+	mu           sync.Mutex
+	progressPath string
+	progress     logProgress
+	sessionStart time.Time
+	resumeElapse float64
+	attempts     uint64 // atomic; attempts reported since the last saveProgressLocked
+}
+
+// logProgress is the JSON shape persisted next to the log file.
+type logProgress struct {
+	Target         int     `json:"target"`
+	Found          int     `json:"found"`
+	TotalAttempts  uint64  `json:"total_attempts"`
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+}
+
+// openOutputLog opens (or creates) logPath for appending and loads its
+// progress sidecar, if any. target is only used to seed a fresh sidecar;
+// on resume the previously-recorded target wins.
+func openOutputLog(logPath string, target int) (*outputLog, error) {
+	file, err := os.OpenFile(logPath, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("opening log file: %w", err)
+	}
+
+	l := &outputLog{
+		file:         file,
+		progressPath: logPath + ".progress.json",
+		sessionStart: time.Now(),
+	}
+	l.progress.Target = target
+
+	if data, readErr := ioutil.ReadFile(l.progressPath); readErr == nil {
+		if jsonErr := json.Unmarshal(data, &l.progress); jsonErr != nil {
+			file.Close()
+			return nil, fmt.Errorf("parsing progress sidecar %s: %w", l.progressPath, jsonErr)
+		}
+		l.resumeElapse = l.progress.ElapsedSeconds
+	}
+
+	return l, nil
+}
+
+// remaining reports how many more matches are needed to reach the log's
+// target, which may already be partly satisfied by a previous run.
+func (l *outputLog) remaining() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.progress.Target - l.progress.Found
+}
+
+// append writes one match as a log line and persists updated progress. It
+// returns the 1-based index of the match within this log. Once Found has
+// reached Target it reports errLogTargetReached and leaves the log
+// untouched, so several workers racing to complete a reachable prefix at
+// once can't push Found past Target.
+func (l *outputLog) append(onionAddress string, publicKey ed25519.PublicKey, secretKey [64]byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.progress.Found >= l.progress.Target {
+		return 0, errLogTargetReached
+	}
+
+	l.progress.Found++
+	index := l.progress.Found
+
+	publicKeyFile := append([]byte(torPublicKeyHeader), publicKey...)
+	secretKeyFile := append([]byte(torSecretKeyHeader), secretKey[:]...)
+
+	line := fmt.Sprintf("%d %s.onion %s %s\n",
+		index, onionAddress,
+		base64.StdEncoding.EncodeToString(publicKeyFile),
+		base64.StdEncoding.EncodeToString(secretKeyFile))
+
+	if _, err := l.file.WriteString(line); err != nil {
+		return 0, fmt.Errorf("writing log line: %w", err)
+	}
+
+	return index, l.saveProgressLocked()
+}
+
+// foundTarget reports the log's current Found/Target counts under lock, for
+// callers (like the periodic progress print) that don't otherwise hold l.mu.
+func (l *outputLog) foundTarget() (found, target int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.progress.Found, l.progress.Target
+}
+
+// attemptsPerSecond reports the log's cumulative attempts/sec, combining
+// whatever was persisted from prior runs with this session's progress so far.
+func (l *outputLog) attemptsPerSecond() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	elapsed := l.resumeElapse + time.Since(l.sessionStart).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(l.progress.TotalAttempts+atomic.LoadUint64(&l.attempts)) / elapsed
+}
+
+// addAttempts folds n newly-made attempts into the cumulative total the
+// progress sidecar tracks. Safe to call from any worker goroutine.
+func (l *outputLog) addAttempts(n uint64) {
+	atomic.AddUint64(&l.attempts, n)
+}
+
+// flushProgress persists whatever attempts/elapsed time have accumulated
+// since the last save, without requiring a match to have just been found.
+func (l *outputLog) flushProgress() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.saveProgressLocked()
+}
+
+// saveProgressLocked writes the sidecar; callers must hold l.mu.
+func (l *outputLog) saveProgressLocked() error {
+	l.progress.TotalAttempts += atomic.SwapUint64(&l.attempts, 0)
+	l.progress.ElapsedSeconds = l.resumeElapse + time.Since(l.sessionStart).Seconds()
+
+	data, err := json.MarshalIndent(l.progress, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding progress sidecar: %w", err)
+	}
+	return ioutil.WriteFile(l.progressPath, data, 0600)
+}
+
+func (l *outputLog) close() error {
+	return l.file.Close()
+}
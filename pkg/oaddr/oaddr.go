@@ -0,0 +1,86 @@
+// Package oaddr parses, validates, and encodes Tor v3 (".onion") addresses.
+//
+// A v3 onion address is the base32 encoding of a 32-byte ed25519 public
+// key, a 2-byte checksum, and a 1-byte version, as defined by the Tor
+// rend-spec-v3 address format.
+package oaddr
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base32"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// addressLength is the decoded length of a v3 onion address: a 32-byte
+// public key, a 2-byte checksum, and a 1-byte version.
+const addressLength = ed25519.PublicKeySize + 2 + 1
+
+// version is the only version byte Tor currently defines for v3 addresses.
+const version = 0x03
+
+// Parse decodes and validates addr, which may be given with or without its
+// ".onion" suffix, and returns the public key it encodes.
+func Parse(addr string) (ed25519.PublicKey, error) {
+	trimmed := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(addr)), ".ONION")
+
+	decoded, err := base32.StdEncoding.DecodeString(trimmed)
+	if err != nil {
+		return nil, fmt.Errorf("oaddr: invalid base32 encoding: %w", err)
+	}
+	if len(decoded) != addressLength {
+		return nil, fmt.Errorf("oaddr: invalid address length %d, want %d", len(decoded), addressLength)
+	}
+
+	pubKey := ed25519.PublicKey(decoded[:ed25519.PublicKeySize])
+	checksum := decoded[ed25519.PublicKeySize : ed25519.PublicKeySize+2]
+	ver := decoded[ed25519.PublicKeySize+2]
+
+	if ver != version {
+		return nil, fmt.Errorf("oaddr: unsupported version byte 0x%02x", ver)
+	}
+
+	want := Checksum(pubKey)
+	if !bytes.Equal(checksum, want[:]) {
+		return nil, fmt.Errorf("oaddr: checksum mismatch")
+	}
+
+	return pubKey, nil
+}
+
+// Validate reports whether addr is a well-formed, correctly-checksummed v3
+// onion address, without returning the decoded public key.
+func Validate(addr string) error {
+	_, err := Parse(addr)
+	return err
+}
+
+// Encode returns the lowercase onion address (without the ".onion" suffix)
+// for pubKey.
+func Encode(pubKey ed25519.PublicKey) string {
+	checksum := Checksum(pubKey)
+
+	var buf bytes.Buffer
+	buf.Write(pubKey)
+	buf.Write(checksum[:])
+	buf.WriteByte(version)
+
+	return strings.ToLower(base32.StdEncoding.EncodeToString(buf.Bytes()))
+}
+
+// Checksum computes the two checksum bytes embedded in a v3 address:
+// SHA3-256(".onion checksum" || pubkey || version)[:2].
+func Checksum(pubKey ed25519.PublicKey) [2]byte {
+	var buf bytes.Buffer
+	buf.WriteString(".onion checksum")
+	buf.Write(pubKey)
+	buf.WriteByte(version)
+	sum := sha3.Sum256(buf.Bytes())
+
+	var out [2]byte
+	copy(out[:], sum[:2])
+	return out
+}
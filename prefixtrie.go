@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// base32Alphabet is the alphabet onion addresses (and therefore prefixes)
+// are drawn from; readPrefixFile has already rejected anything outside it.
+const base32Alphabet = "abcdefghijklmnopqrstuvwxyz234567"
+
+// base32Index maps a base32 character to its 0-31 position in the
+// alphabet, or -1 if the byte isn't one of the 32 valid characters.
+var base32Index [256]int8
+
+func init() {
+	for i := range base32Index {
+		base32Index[i] = -1
+	}
+	for i, c := range base32Alphabet {
+		base32Index[c] = int8(i)
+	}
+}
+
+// prefixTrie is a radix tree keyed on 5-bit base32 nibbles. It lets
+// generate() test a candidate address against an entire -prefixfile in
+// O(len(address)) regardless of how many prefixes were loaded, instead of
+// a linear strings.HasPrefix scan over every one of them.
+type prefixTrie struct {
+	children [32]*prefixTrie
+	prefix   string // non-empty at the node where a loaded prefix terminates
+}
+
+// insertResult reports what happened when adding a prefix to the trie.
+type insertResult int
+
+const (
+	insertOK insertResult = iota
+	insertShadowed
+)
+
+// insert adds prefix to the trie. If a shorter prefix already loaded
+// terminates somewhere along prefix's path, prefix can never be the one
+// reported by match (the shorter one always matches first), so insert
+// leaves the trie unchanged and reports insertShadowed.
+func (t *prefixTrie) insert(prefix string) insertResult {
+	node := t
+	for i := 0; i < len(prefix); i++ {
+		if node.prefix != "" {
+			return insertShadowed
+		}
+		idx := base32Index[prefix[i]]
+		if node.children[idx] == nil {
+			node.children[idx] = &prefixTrie{}
+		}
+		node = node.children[idx]
+	}
+	node.prefix = prefix
+	return insertOK
+}
+
+// match walks addr down the trie and returns the first (necessarily
+// shortest) loaded prefix that addr starts with.
+func (t *prefixTrie) match(addr string) (string, bool) {
+	node := t
+	for i := 0; i < len(addr); i++ {
+		if node.prefix != "" {
+			return node.prefix, true
+		}
+		idx := base32Index[addr[i]]
+		if idx < 0 || node.children[idx] == nil {
+			return "", false
+		}
+		node = node.children[idx]
+	}
+	return node.prefix, node.prefix != ""
+}
+
+// buildPrefixTrie loads prefixes into a prefixTrie, reporting (and
+// dropping) exact duplicates and prefixes shadowed by a shorter one also
+// loaded. Prefixes are inserted shortest-first regardless of the order
+// they were given in, so that a shorter prefix loaded after a longer one
+// on the same path is still detected as shadowing it - not just the
+// reverse.
+func buildPrefixTrie(prefixes []string) *prefixTrie {
+	ordered := make([]string, len(prefixes))
+	copy(ordered, prefixes)
+	sort.SliceStable(ordered, func(i, j int) bool { return len(ordered[i]) < len(ordered[j]) })
+
+	trie := &prefixTrie{}
+	seen := make(map[string]bool, len(ordered))
+
+	for _, p := range ordered {
+		if seen[p] {
+			fmt.Printf("Warning: duplicate prefix %q ignored\n", p)
+			continue
+		}
+		seen[p] = true
+
+		if trie.insert(p) == insertShadowed {
+			fmt.Printf("Warning: prefix %q is shadowed by a shorter loaded prefix and will never be reported\n", p)
+		}
+	}
+
+	return trie
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/cretz/bine/control"
+)
+
+// publishConfig holds the -publish-related CLI flags.
+type publishConfig struct {
+	enabled         bool
+	remotePort      int
+	localPort       int
+	controlAddr     string
+	controlPassword string
+	embedded        bool
+}
+
+// parsePublishPort parses a "remote:local" port spec such as "80:8080"
+// into the port Tor advertises on the hidden service and the local port
+// traffic is forwarded to.
+func parsePublishPort(spec string) (remotePort, localPort int, err error) {
+	parts := strings.SplitN(spec, ":", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("publish: expected <remote-port>:<local-port>, got %q", spec)
+	}
+	if remotePort, err = strconv.Atoi(parts[0]); err != nil {
+		return 0, 0, fmt.Errorf("publish: invalid remote port %q: %w", parts[0], err)
+	}
+	if localPort, err = strconv.Atoi(parts[1]); err != nil {
+		return 0, 0, fmt.Errorf("publish: invalid local port %q: %w", parts[1], err)
+	}
+	return remotePort, localPort, nil
+}
+
+// publisher owns the single Tor control connection that every match found
+// during a run publishes through. It's created once up front and reused
+// for each match, rather than standing up a new Tor process or control
+// connection per match.
+type publisher struct {
+	ctrl *control.Conn
+	stop func()
+}
+
+// newPublisher opens the control connection publish will reuse for the
+// rest of the run: either an embedded in-process tor (only available when
+// built with -tags embedded_tor; see publish_embedded.go) or a connection
+// to an already-running tor's control port at cfg.controlAddr.
+func newPublisher(ctx context.Context, cfg publishConfig) (*publisher, error) {
+	if cfg.embedded {
+		return newEmbeddedPublisher(ctx)
+	}
+
+	conn, err := net.Dial("tcp", cfg.controlAddr)
+	if err != nil {
+		return nil, fmt.Errorf("publish: dialing control port %s: %w", cfg.controlAddr, err)
+	}
+
+	ctrl := control.NewConn(textproto.NewConn(conn))
+	if err := ctrl.Authenticate(cfg.controlPassword); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("publish: authenticating to control port: %w", err)
+	}
+
+	return &publisher{ctrl: ctrl, stop: func() { conn.Close() }}, nil
+}
+
+// publish registers onionKeyBase64 - the base64-encoded ED25519-V3
+// expanded secret key produced by expandSecretKey, the same bytes
+// saveTorFormat writes to hs_ed25519_secret_key - as an ephemeral hidden
+// service on p's connection, forwarding remotePort to 127.0.0.1:localPort.
+//
+// tor.Listen's Key field only accepts a standard ed25519.PrivateKey seed,
+// which the incremental scalar search (see generate) never produces, so
+// this talks ADD_ONION directly over the control connection instead.
+func (p *publisher) publish(remotePort, localPort int, onionKeyBase64 string) (onionAddress string, err error) {
+	resp, err := p.ctrl.SendRequest("ADD_ONION %s Flags=Detach Port=%d,127.0.0.1:%d",
+		"ED25519-V3:"+onionKeyBase64, remotePort, localPort)
+	if err != nil {
+		return "", fmt.Errorf("publish: ADD_ONION failed: %w", err)
+	}
+
+	for _, line := range resp.Data {
+		if strings.HasPrefix(line, "ServiceID=") {
+			return strings.TrimPrefix(line, "ServiceID=") + ".onion", nil
+		}
+	}
+
+	return "", fmt.Errorf("publish: ADD_ONION response did not include a ServiceID")
+}
+
+// close releases whatever resources newPublisher acquired (the embedded
+// tor process, or the dialed control connection).
+func (p *publisher) close() {
+	if p.stop != nil {
+		p.stop()
+	}
+}
@@ -0,0 +1,25 @@
+//go:build embedded_tor
+
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cretz/bine/process/embedded"
+	"github.com/cretz/bine/tor"
+)
+
+// newEmbeddedPublisher starts one in-process tor for the lifetime of the
+// run and reuses it for every match. Gated behind the embedded_tor build
+// tag because process/embedded statically links github.com/cretz/tor-static,
+// which requires a pre-built Tor C library most toolchains don't have on
+// hand - plain `go build` must keep working without it.
+func newEmbeddedPublisher(ctx context.Context) (*publisher, error) {
+	t, err := tor.Start(ctx, &tor.StartConf{ProcessCreator: embedded.NewCreator()})
+	if err != nil {
+		return nil, fmt.Errorf("publish: starting embedded tor: %w", err)
+	}
+
+	return &publisher{ctrl: t.Control, stop: func() { t.Close() }}, nil
+}
@@ -0,0 +1,16 @@
+//go:build !embedded_tor
+
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// newEmbeddedPublisher is unavailable in the default build: process/embedded
+// statically links github.com/cretz/tor-static, which requires a pre-built
+// Tor C library most toolchains don't have on hand. Build with
+// -tags embedded_tor to enable -embedded.
+func newEmbeddedPublisher(ctx context.Context) (*publisher, error) {
+	return nil, fmt.Errorf("publish: -embedded requires building with -tags embedded_tor")
+}